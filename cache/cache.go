@@ -0,0 +1,194 @@
+// Package cache gives Mail.app messages stable, incrementing 32-bit
+// UIDs and caches their parsed envelope data, so a syncing client
+// (an IMAP or JMAP frontend, say) can do incremental scans instead
+// of re-reading the whole Envelope Index and every .emlx file on
+// each pass.
+package cache
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/saranrapjs/maildotapp"
+)
+
+var (
+	uidsBucket     = []byte("uids")
+	metaBucket     = []byte("meta")
+	envelopeBucket = []byte("envelopes")
+)
+
+// Cache is a bbolt-backed store mapping Mail.app ROWIDs to stable
+// UIDs, one mailbox (keyed by Mailbox.URL()) at a time.
+type Cache struct {
+	db *bolt.DB
+}
+
+// Open opens (creating if necessary) a Cache at path.
+func Open(path string) (*Cache, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Cache{db: db}, nil
+}
+
+func (c *Cache) Close() error {
+	return c.db.Close()
+}
+
+func mailboxBucket(tx *bolt.Tx, bucket []byte, mbox maildotapp.Mailbox, create bool) (*bolt.Bucket, error) {
+	root, err := rootBucket(tx, bucket, create)
+	if err != nil || root == nil {
+		return nil, err
+	}
+	key := []byte(mbox.URL())
+	if create {
+		return root.CreateBucketIfNotExists(key)
+	}
+	return root.Bucket(key), nil
+}
+
+func rootBucket(tx *bolt.Tx, bucket []byte, create bool) (*bolt.Bucket, error) {
+	if create {
+		return tx.CreateBucketIfNotExists(bucket)
+	}
+	return tx.Bucket(bucket), nil
+}
+
+// AssignUID returns the stable UID for rowid within mbox, assigning
+// the next available one (and persisting it) if this is the first
+// time rowid has been seen. uidvalidity is constant for the lifetime
+// of the mailbox's bucket; callers should treat a change in it as
+// Mail.app having recreated the mailbox out from under them.
+func (c *Cache) AssignUID(mbox maildotapp.Mailbox, rowid string) (uid uint32, uidvalidity uint32, err error) {
+	err = c.db.Update(func(tx *bolt.Tx) error {
+		uids, err := mailboxBucket(tx, uidsBucket, mbox, true)
+		if err != nil {
+			return err
+		}
+		meta, err := mailboxBucket(tx, metaBucket, mbox, true)
+		if err != nil {
+			return err
+		}
+		uidvalidity = uidValidityFor(meta)
+
+		key := []byte(rowid)
+		if existing := uids.Get(key); existing != nil {
+			uid = binary.BigEndian.Uint32(existing)
+			return nil
+		}
+		next, _ := uids.NextSequence()
+		if next > 1<<32-1 {
+			return fmt.Errorf("cache: mailbox %s has exhausted its 32-bit UID space", mbox.URL())
+		}
+		uid = uint32(next)
+		buf := make([]byte, 4)
+		binary.BigEndian.PutUint32(buf, uid)
+		return uids.Put(key, buf)
+	})
+	return uid, uidvalidity, err
+}
+
+// UIDValidity returns mbox's UIDVALIDITY, minting one the first time
+// it's asked for a mailbox with no cached messages yet.
+func (c *Cache) UIDValidity(mbox maildotapp.Mailbox) (uint32, error) {
+	var uidvalidity uint32
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		meta, err := mailboxBucket(tx, metaBucket, mbox, true)
+		if err != nil {
+			return err
+		}
+		uidvalidity = uidValidityFor(meta)
+		return nil
+	})
+	return uidvalidity, err
+}
+
+// uidValidityFor returns meta's stored UIDVALIDITY, minting and
+// persisting one (derived from bbolt's own sequence counter) the
+// first time it's asked for.
+func uidValidityFor(meta *bolt.Bucket) uint32 {
+	const key = "uidvalidity"
+	if existing := meta.Get([]byte(key)); existing != nil {
+		return binary.BigEndian.Uint32(existing)
+	}
+	next, _ := meta.NextSequence()
+	uidvalidity := uint32(next)
+	if uidvalidity == 0 {
+		uidvalidity = 1
+	}
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, uidvalidity)
+	meta.Put([]byte(key), buf)
+	return uidvalidity
+}
+
+// PutEnvelope caches env for rowid within mbox, so future lookups
+// don't need to re-open the message's .emlx file.
+func (c *Cache) PutEnvelope(mbox maildotapp.Mailbox, rowid string, env maildotapp.Envelope) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := mailboxBucket(tx, envelopeBucket, mbox, true)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(env)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(rowid), data)
+	})
+}
+
+// Envelope returns the cached envelope for rowid within mbox, and
+// whether one was found.
+func (c *Cache) Envelope(mbox maildotapp.Mailbox, rowid string) (maildotapp.Envelope, bool, error) {
+	var env maildotapp.Envelope
+	var found bool
+	err := c.db.View(func(tx *bolt.Tx) error {
+		bucket, err := mailboxBucket(tx, envelopeBucket, mbox, false)
+		if err != nil || bucket == nil {
+			return err
+		}
+		data := bucket.Get([]byte(rowid))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &env)
+	})
+	return env, found, err
+}
+
+// Prune drops every cached UID and envelope for mbox whose ROWID is
+// not present in live, which callers should populate from a fresh
+// scan of the Envelope Index.
+func (c *Cache) Prune(mbox maildotapp.Mailbox, live map[string]bool) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		for _, bucketName := range [][]byte{uidsBucket, envelopeBucket} {
+			bucket, err := mailboxBucket(tx, bucketName, mbox, false)
+			if err != nil || bucket == nil {
+				continue
+			}
+			var stale [][]byte
+			err = bucket.ForEach(func(k, v []byte) error {
+				if !live[string(k)] {
+					stale = append(stale, append([]byte{}, k...))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range stale {
+				if err := bucket.Delete(k); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
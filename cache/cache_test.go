@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/saranrapjs/maildotapp"
+)
+
+func testMailbox(name string) maildotapp.Mailbox {
+	return maildotapp.Mailbox{
+		Name:    name,
+		Account: &maildotapp.Account{Name: "test", UUID: "ACCOUNT-UUID"},
+	}
+}
+
+func openTestCache(t *testing.T) *Cache {
+	t.Helper()
+	c, err := Open(filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestAssignUIDIsStableAndIncreasing(t *testing.T) {
+	c := openTestCache(t)
+	mbox := testMailbox(maildotapp.Inbox)
+
+	uid1, _, err := c.AssignUID(mbox, "100")
+	if err != nil {
+		t.Fatalf("AssignUID: %v", err)
+	}
+	uid2, _, err := c.AssignUID(mbox, "200")
+	if err != nil {
+		t.Fatalf("AssignUID: %v", err)
+	}
+	if uid2 <= uid1 {
+		t.Fatalf("expected uid2 (%d) > uid1 (%d)", uid2, uid1)
+	}
+
+	again, _, err := c.AssignUID(mbox, "100")
+	if err != nil {
+		t.Fatalf("AssignUID: %v", err)
+	}
+	if again != uid1 {
+		t.Fatalf("AssignUID for an already-seen rowid returned %d, want %d", again, uid1)
+	}
+}
+
+func TestUIDValidityIsStable(t *testing.T) {
+	c := openTestCache(t)
+	inbox := testMailbox(maildotapp.Inbox)
+
+	v1, err := c.UIDValidity(inbox)
+	if err != nil {
+		t.Fatalf("UIDValidity: %v", err)
+	}
+	if v1 == 0 {
+		t.Fatalf("expected a nonzero UIDVALIDITY")
+	}
+	v2, err := c.UIDValidity(inbox)
+	if err != nil {
+		t.Fatalf("UIDValidity: %v", err)
+	}
+	if v1 != v2 {
+		t.Fatalf("UIDValidity changed across calls: %d then %d", v1, v2)
+	}
+}
+
+func TestPruneDropsStaleUIDsAndEnvelopes(t *testing.T) {
+	c := openTestCache(t)
+	mbox := testMailbox(maildotapp.Inbox)
+
+	if _, _, err := c.AssignUID(mbox, "1"); err != nil {
+		t.Fatalf("AssignUID: %v", err)
+	}
+	oldUID, _, err := c.AssignUID(mbox, "2")
+	if err != nil {
+		t.Fatalf("AssignUID: %v", err)
+	}
+	if err := c.PutEnvelope(mbox, "1", maildotapp.Envelope{Subject: "kept"}); err != nil {
+		t.Fatalf("PutEnvelope: %v", err)
+	}
+	if err := c.PutEnvelope(mbox, "2", maildotapp.Envelope{Subject: "stale"}); err != nil {
+		t.Fatalf("PutEnvelope: %v", err)
+	}
+
+	if err := c.Prune(mbox, map[string]bool{"1": true}); err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+
+	if _, found, err := c.Envelope(mbox, "2"); err != nil {
+		t.Fatalf("Envelope: %v", err)
+	} else if found {
+		t.Fatalf("Prune left rowid 2's envelope behind")
+	}
+	env, found, err := c.Envelope(mbox, "1")
+	if err != nil {
+		t.Fatalf("Envelope: %v", err)
+	}
+	if !found || env.Subject != "kept" {
+		t.Fatalf("Prune dropped rowid 1, which was still live: %+v, found=%v", env, found)
+	}
+
+	// A pruned rowid gets a fresh UID if it reappears, rather than
+	// reusing its old one.
+	uid, _, err := c.AssignUID(mbox, "2")
+	if err != nil {
+		t.Fatalf("AssignUID: %v", err)
+	}
+	if uid == 0 {
+		t.Fatalf("expected a nonzero UID for rowid 2 after reassignment")
+	}
+	if uid == oldUID {
+		t.Fatalf("AssignUID reused pruned rowid 2's old UID %d", oldUID)
+	}
+}
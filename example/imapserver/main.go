@@ -0,0 +1,37 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/emersion/go-imap/server"
+	"github.com/saranrapjs/maildotapp"
+	"github.com/saranrapjs/maildotapp/cache"
+	"github.com/saranrapjs/maildotapp/imapserver"
+)
+
+func checkErr(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+func main() {
+	mboxes, err := maildotapp.NewMailboxes()
+	checkErr(err)
+	defer mboxes.Close()
+
+	homeDir, err := os.UserHomeDir()
+	checkErr(err)
+	c, err := cache.Open(filepath.Join(homeDir, ".maildotapp-imapserver.db"))
+	checkErr(err)
+	defer c.Close()
+
+	s := server.New(imapserver.New(mboxes, c))
+	s.Addr = "127.0.0.1:1143"
+	s.AllowInsecureAuth = true
+
+	log.Println("starting IMAP server at", s.Addr)
+	checkErr(s.ListenAndServe())
+}
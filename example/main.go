@@ -30,6 +30,7 @@ func main() {
 	checkErr(err)
 	r, err := messages[0].Open()
 	checkErr(err)
+	defer r.Close()
 	email, err := mail.ReadMessage(r)
 	checkErr(err)
 	fmt.Println(email.Header.Get("Subject"))
@@ -0,0 +1,45 @@
+// Package imapserver exposes a maildotapp.Mailboxes as a read-only
+// go-imap backend, so that IMAP clients (aerc, mutt, Thunderbird,
+// alps, etc.) can browse Mail.app's messages without needing the
+// user's mail account credentials.
+package imapserver
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/saranrapjs/maildotapp"
+	"github.com/saranrapjs/maildotapp/cache"
+)
+
+// ErrReadOnly is returned by any operation that would mutate
+// Mail.app's store. This server only ever reads from the Envelope
+// Index and .emlx files on disk.
+var ErrReadOnly = errors.New("imapserver: read-only backend, write operations are not supported")
+
+// Backend adapts a maildotapp.Mailboxes into a backend.Backend. A
+// single Mail.app library is shared by all logged-in users; the
+// username passed to Login selects which Mail.app Account's
+// mailboxes are visible. UIDs and UIDVALIDITYs handed out to IMAP
+// clients come from cache rather than straight off ROWID: each ROWID
+// is given the next UID in its mailbox the first time it is seen, and
+// keeps that UID from then on.
+type Backend struct {
+	mboxes maildotapp.Mailboxes
+	cache  *cache.Cache
+}
+
+// New wraps mboxes as a go-imap backend.Backend, minting UIDs
+// through c.
+func New(mboxes maildotapp.Mailboxes, c *cache.Cache) *Backend {
+	return &Backend{mboxes: mboxes, cache: c}
+}
+
+// Login ignores the password: Mail.app itself already owns the
+// account credentials, so this server trusts anything running
+// locally enough to reach it and only uses username to pick the
+// Account whose mailboxes should be exposed.
+func (be *Backend) Login(_ *imap.ConnInfo, username, _ string) (backend.User, error) {
+	return &User{username: username, be: be}, nil
+}
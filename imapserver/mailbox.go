@@ -0,0 +1,142 @@
+package imapserver
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/saranrapjs/maildotapp"
+)
+
+// Mailbox adapts a maildotapp.Mailbox into a backend.Mailbox. It is
+// read-only: STORE, APPEND, COPY and EXPUNGE all fail with
+// ErrReadOnly.
+type Mailbox struct {
+	mbox maildotapp.Mailbox
+	be   *Backend
+}
+
+func (mbx *Mailbox) Name() string {
+	return mbx.mbox.Name
+}
+
+func (mbx *Mailbox) Info() (*imap.MailboxInfo, error) {
+	return &imap.MailboxInfo{
+		Delimiter: "/",
+		Name:      mbx.mbox.Name,
+	}, nil
+}
+
+func (mbx *Mailbox) messages() ([]maildotapp.Message, error) {
+	query := mbx.be.mboxes.Query(maildotapp.MailboxQuery{Mailbox: mbx.mbox})
+	return query()
+}
+
+// uid resolves m's cache-assigned UID, scoped to this mailbox,
+// rather than handing its raw ROWID straight to the IMAP client.
+func (mbx *Mailbox) uid(m maildotapp.Message) (uint32, error) {
+	rowID, err := m.UID()
+	if err != nil {
+		return 0, err
+	}
+	uid, _, err := mbx.be.cache.AssignUID(mbx.mbox, strconv.FormatUint(uint64(rowID), 10))
+	return uid, err
+}
+
+func (mbx *Mailbox) Status(items []imap.StatusItem) (*imap.MailboxStatus, error) {
+	msgs, err := mbx.messages()
+	if err != nil {
+		return nil, err
+	}
+	uidvalidity, err := mbx.be.cache.UIDValidity(mbx.mbox)
+	if err != nil {
+		return nil, err
+	}
+	status := imap.NewMailboxStatus(mbx.mbox.Name, items)
+	status.Messages = uint32(len(msgs))
+	status.UidValidity = uidvalidity
+	return status, nil
+}
+
+func (mbx *Mailbox) SetSubscribed(subscribed bool) error {
+	return ErrReadOnly
+}
+
+func (mbx *Mailbox) Check() error {
+	return nil
+}
+
+func (mbx *Mailbox) ListMessages(uid bool, seqset *imap.SeqSet, items []imap.FetchItem, ch chan<- *imap.Message) error {
+	defer close(ch)
+	msgs, err := mbx.messages()
+	if err != nil {
+		return err
+	}
+	for seqNum, m := range msgs {
+		msgUID, err := mbx.uid(m)
+		if err != nil {
+			continue
+		}
+		id := uint32(seqNum + 1)
+		if uid {
+			id = msgUID
+		}
+		if !seqset.Contains(id) {
+			continue
+		}
+		fetched, err := fetchMessage(m, uint32(seqNum+1), msgUID, items)
+		if err != nil {
+			return err
+		}
+		ch <- fetched
+	}
+	return nil
+}
+
+// SearchMessages filters against the Envelope Index via
+// maildotapp.MailboxQuery, rather than opening and parsing every
+// message's .emlx file: exactly the search Subject/From/Since/Before
+// columns MailboxQuery already exposes.
+func (mbx *Mailbox) SearchMessages(uid bool, criteria *imap.SearchCriteria) ([]uint32, error) {
+	mq := maildotapp.MailboxQuery{Mailbox: mbx.mbox}
+	if criteria != nil {
+		mq.SubjectContains = criteria.Header.Get("Subject")
+		mq.From = criteria.Header.Get("From")
+		mq.Since = criteria.Since
+		mq.Before = criteria.Before
+	}
+	query := mbx.be.mboxes.Query(mq)
+	msgs, err := query()
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint32
+	for seqNum, m := range msgs {
+		if uid {
+			msgUID, err := mbx.uid(m)
+			if err != nil {
+				continue
+			}
+			ids = append(ids, msgUID)
+		} else {
+			ids = append(ids, uint32(seqNum+1))
+		}
+	}
+	return ids, nil
+}
+
+func (mbx *Mailbox) CreateMessage(flags []string, date time.Time, body imap.Literal) error {
+	return ErrReadOnly
+}
+
+func (mbx *Mailbox) UpdateMessagesFlags(uid bool, seqset *imap.SeqSet, op imap.FlagsOp, flags []string) error {
+	return ErrReadOnly
+}
+
+func (mbx *Mailbox) CopyMessages(uid bool, seqset *imap.SeqSet, destName string) error {
+	return ErrReadOnly
+}
+
+func (mbx *Mailbox) Expunge() error {
+	return ErrReadOnly
+}
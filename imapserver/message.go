@@ -0,0 +1,79 @@
+package imapserver
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/backendutil"
+	"github.com/emersion/go-message/textproto"
+	"github.com/saranrapjs/maildotapp"
+)
+
+// rawMessage reads and buffers the full RFC 5322 contents of m, so
+// it can be reused both for header parsing and for the body of a
+// FETCH response.
+func rawMessage(m maildotapp.Message) ([]byte, error) {
+	r, err := m.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// fetchMessage builds an *imap.Message satisfying items, pulling
+// ENVELOPE, BODY[] and BODY.PEEK[] from the message's raw RFC 5322
+// contents, and FLAGS and INTERNALDATE from m.Envelope.
+func fetchMessage(m maildotapp.Message, seqNum, uid uint32, items []imap.FetchItem) (*imap.Message, error) {
+	raw, err := rawMessage(m)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(bytes.NewReader(raw))
+	header, err := textproto.ReadHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(br)
+	if err != nil {
+		return nil, err
+	}
+	msg := imap.NewMessage(seqNum, items)
+	for _, item := range items {
+		switch item {
+		case imap.FetchUid:
+			msg.Uid = uid
+		case imap.FetchFlags:
+			var flags []string
+			if m.Envelope.Flags.Read {
+				flags = append(flags, imap.SeenFlag)
+			}
+			if m.Envelope.Flags.Flagged {
+				flags = append(flags, imap.FlaggedFlag)
+			}
+			msg.Flags = flags
+		case imap.FetchEnvelope:
+			msg.Envelope, err = backendutil.FetchEnvelope(header)
+			if err != nil {
+				return nil, err
+			}
+		case imap.FetchInternalDate:
+			// date_received, populated on m.Envelope by Mailboxes.Query,
+			// is exactly what the request asks INTERNALDATE to come from.
+			msg.InternalDate = m.Envelope.Date
+		default:
+			section, err := imap.ParseBodySectionName(item)
+			if err != nil {
+				continue
+			}
+			literal, err := backendutil.FetchBodySection(header, bytes.NewReader(body), section)
+			if err != nil {
+				continue
+			}
+			msg.Body[section] = literal
+		}
+	}
+	return msg, nil
+}
@@ -0,0 +1,48 @@
+package imapserver
+
+import (
+	"github.com/emersion/go-imap/backend"
+)
+
+// User represents the Mail.app Account selected at Login.
+type User struct {
+	username string
+	be       *Backend
+}
+
+func (u *User) Username() string {
+	return u.username
+}
+
+func (u *User) ListMailboxes(subscribed bool) ([]backend.Mailbox, error) {
+	mboxes := u.be.mboxes.MailboxesForAccount(u.username)
+	result := make([]backend.Mailbox, len(mboxes))
+	for i, mbox := range mboxes {
+		result[i] = &Mailbox{mbox: mbox, be: u.be}
+	}
+	return result, nil
+}
+
+func (u *User) GetMailbox(name string) (backend.Mailbox, error) {
+	mbox, err := u.be.mboxes.Mailbox(u.username, name)
+	if err != nil {
+		return nil, err
+	}
+	return &Mailbox{mbox: mbox, be: u.be}, nil
+}
+
+func (u *User) CreateMailbox(name string) error {
+	return ErrReadOnly
+}
+
+func (u *User) DeleteMailbox(name string) error {
+	return ErrReadOnly
+}
+
+func (u *User) RenameMailbox(existingName, newName string) error {
+	return ErrReadOnly
+}
+
+func (u *User) Logout() error {
+	return nil
+}
@@ -15,6 +15,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -60,8 +61,30 @@ func (m Mailbox) IsEmpty() bool {
 type MailboxQuery struct {
 	Mailbox      Mailbox
 	BatchResults int
+
+	// Since and Before restrict results to messages received within
+	// the given range. A zero time.Time leaves that side unbounded.
+	Since  time.Time
+	Before time.Time
+	// From matches (via SQL LIKE) against the message's sender.
+	From string
+	// SubjectContains matches (via SQL LIKE) against the message's
+	// subject.
+	SubjectContains string
+	UnreadOnly      bool
+	FlaggedOnly     bool
+	HasAttachments  bool
+	// MessageIDs, if non-empty, restricts results to messages whose
+	// Message-ID header matches one of these values.
+	MessageIDs []string
 }
 
+// flagAttachmentBit is the bit Mail.app sets in the messages.flags
+// column of the Envelope Index when a message has at least one
+// attachment. Undocumented by Apple; reverse-engineered by poking at
+// the database.
+const flagAttachmentBit = 1 << 12
+
 // Mail.app (or IMAP? I'm not sure) uses "INBOX"
 // as the standard name for account inboxes.
 const Inbox = "INBOX"
@@ -75,10 +98,72 @@ func (m Mailboxes) Mailbox(account, name string) (Mailbox, error) {
 	return Mailbox{}, errors.New(fmt.Sprintf("couldn't find mailbox '%s' for account '%s'", name, account))
 }
 
+// mailboxByURL reverse-looks-up a Mailbox from the URL stored
+// against it in the Envelope Index.
+func (m Mailboxes) mailboxByURL(u string) (Mailbox, bool) {
+	for _, mailboxes := range m.byAccountName {
+		for _, mbox := range mailboxes {
+			if mbox.URL() == u {
+				return mbox, true
+			}
+		}
+	}
+	return Mailbox{}, false
+}
+
+// MailboxesForAccount lists every Mailbox known for the given
+// account name.
+func (m Mailboxes) MailboxesForAccount(account string) []Mailbox {
+	var mboxes []Mailbox
+	for _, mbox := range m.byAccountName[account] {
+		mboxes = append(mboxes, mbox)
+	}
+	return mboxes
+}
+
 func (m Mailboxes) Query(mq MailboxQuery) func() ([]Message, error) {
 	query := getMessages
+	var conditions []string
+	var args []interface{}
 	if !mq.Mailbox.IsEmpty() {
-		query += "\nWHERE mbx.url = ?"
+		conditions = append(conditions, "mbx.url = ?")
+		args = append(args, mq.Mailbox.URL())
+	}
+	if !mq.Since.IsZero() {
+		conditions = append(conditions, "m.date_received >= ?")
+		args = append(args, mq.Since.Unix())
+	}
+	if !mq.Before.IsZero() {
+		conditions = append(conditions, "m.date_received <= ?")
+		args = append(args, mq.Before.Unix())
+	}
+	if mq.From != "" {
+		conditions = append(conditions, "m.sender LIKE ?")
+		args = append(args, "%"+mq.From+"%")
+	}
+	if mq.SubjectContains != "" {
+		conditions = append(conditions, "m.subject LIKE ?")
+		args = append(args, "%"+mq.SubjectContains+"%")
+	}
+	if mq.UnreadOnly {
+		conditions = append(conditions, "m.read = 0")
+	}
+	if mq.FlaggedOnly {
+		conditions = append(conditions, "m.flagged = 1")
+	}
+	if mq.HasAttachments {
+		conditions = append(conditions, "m.flags & ? != 0")
+		args = append(args, flagAttachmentBit)
+	}
+	if len(mq.MessageIDs) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(mq.MessageIDs)), ",")
+		conditions = append(conditions, fmt.Sprintf("m.message_id IN (%s)", placeholders))
+		for _, id := range mq.MessageIDs {
+			args = append(args, id)
+		}
+	}
+	if len(conditions) > 0 {
+		query += "\nWHERE " + strings.Join(conditions, " AND ")
 	}
 	query += "\nORDER BY m.date_received DESC"
 	var batchCount int
@@ -86,11 +171,8 @@ func (m Mailboxes) Query(mq MailboxQuery) func() ([]Message, error) {
 		query += "\nLIMIT ? OFFSET ?"
 	}
 	return func() ([]Message, error) {
-		var variables []interface{}
+		variables := append([]interface{}{}, args...)
 		var msgs []Message
-		if !mq.Mailbox.IsEmpty() {
-			variables = append(variables, mq.Mailbox.URL())
-		}
 		if mq.BatchResults > 0 {
 			variables = append(variables, mq.BatchResults, batchCount*mq.BatchResults)
 		}
@@ -100,8 +182,10 @@ func (m Mailboxes) Query(mq MailboxQuery) func() ([]Message, error) {
 		}
 		defer rows.Close()
 		for rows.Next() {
-			var ROWID, u string
-			if err := rows.Scan(&ROWID, &u); err != nil {
+			var ROWID, u, sender, subject string
+			var dateReceived int64
+			var read, flagged bool
+			if err := rows.Scan(&ROWID, &u, &sender, &subject, &dateReceived, &read, &flagged); err != nil {
 				return nil, err
 			}
 			MailboxURL, _ := url.Parse(u)
@@ -110,8 +194,23 @@ func (m Mailboxes) Query(mq MailboxQuery) func() ([]Message, error) {
 			if !ok {
 				return nil, fmt.Errorf("unmatched mailbox path: %s", relativePath)
 			}
+			rowMailbox := mq.Mailbox
+			if rowMailbox.IsEmpty() {
+				rowMailbox, _ = m.mailboxByURL(u)
+			}
 			msgs = append(msgs, Message{
 				pathWithoutExtension: path.Join(basePath, emlPathFromROWID(ROWID)),
+				rowID:                ROWID,
+				mailbox:              rowMailbox,
+				Envelope: Envelope{
+					Subject: subject,
+					From:    sender,
+					Date:    time.Unix(dateReceived, 0),
+					Flags: EnvelopeFlags{
+						Read:    read,
+						Flagged: flagged,
+					},
+				},
 			})
 		}
 		return msgs, nil
@@ -168,7 +267,12 @@ func getMailboxes() ([]Mailbox, error) {
 const getMessages = `
 SELECT
 	m.ROWID as id,
-	mbx.url as url
+	mbx.url as url,
+	m.sender as sender,
+	m.subject as subject,
+	m.date_received as date_received,
+	m.read as read,
+	m.flagged as flagged
 FROM
 	messages m
 LEFT JOIN
@@ -231,12 +335,57 @@ func (m Mailboxes) Close() error {
 	return m.db.Close()
 }
 
+// EnvelopeFlags holds the boolean flag columns the Envelope Index
+// stores per message.
+type EnvelopeFlags struct {
+	Read    bool
+	Flagged bool
+}
+
+// Envelope holds the subset of a message's headers that the
+// Envelope Index stores inline, so callers can filter or display
+// messages without opening each .emlx file. To is left blank:
+// Mail.app stores recipients in a separate "recipients" table that
+// Query doesn't join against.
+type Envelope struct {
+	Subject string
+	From    string
+	To      string
+	Date    time.Time
+	Flags   EnvelopeFlags
+}
+
 // Message represents a Mail.app Email message.
 type Message struct {
 	pathWithoutExtension string
+	rowID                string
+
+	// Envelope is populated when the Message came from
+	// Mailboxes.Query, which reads it from the Envelope Index.
+	Envelope Envelope
+
+	// mailbox is the Mailbox this Message was looked up from, when
+	// known. Write operations (SetRead, MoveTo, ...) need it to scope
+	// their AppleScript lookups to a single mailbox instead of
+	// searching the whole store.
+	mailbox Mailbox
 }
 
-func (m Message) Open() (io.Reader, error) {
+// UID returns the message's underlying sqlite ROWID, parsed as a
+// number. ROWIDs are stable for the lifetime of a message in the
+// Envelope Index, which makes them usable as IMAP UIDs.
+func (m Message) UID() (uint32, error) {
+	uid, err := strconv.ParseUint(m.rowID, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("message has no valid ROWID: %w", err)
+	}
+	return uint32(uid), nil
+}
+
+// Open returns the message's clean RFC 5322 contents, with Mail.app's
+// proprietary .emlx framing stripped off by stripEmlx. Callers must
+// Close the result to release the underlying file.
+func (m Message) Open() (io.ReadCloser, error) {
 	f1, err := os.Open(path.Join(m.pathWithoutExtension + ".emlx"))
 	if err == nil {
 		return stripEmlx(f1)
@@ -256,28 +405,42 @@ func emlPathFromROWID(ROWID string) string {
 	return fmt.Sprintf("%s/%s/%s/Messages/%s", string(ROWID[2]), string(ROWID[1]), string(ROWID[0]), ROWID)
 }
 
+// readCloser pairs a Reader over part of f's contents with f itself,
+// so the caller has a single handle to Close when it's done, instead
+// of leaking the underlying *os.File.
+type readCloser struct {
+	io.Reader
+	f *os.File
+}
+
+func (rc readCloser) Close() error {
+	return rc.f.Close()
+}
+
 // stripEmlx takes an Apple-formatted ".emlx" file, and
-// returns an io.Reader which strips the proprietary Apple
+// returns an io.ReadCloser which strips the proprietary Apple
 // parts of that file, so that other email parsers
-// won't break.
-func stripEmlx(r io.ReadSeeker) (io.Reader, error) {
-	scanner := bufio.NewScanner(r)
+// won't break. Closing it closes f.
+func stripEmlx(f *os.File) (io.ReadCloser, error) {
+	scanner := bufio.NewScanner(f)
 	if scanner.Scan() {
 		// The first line in eml specifies the number of bytes.
 		original := scanner.Bytes()
 		stringByteNum := bytes.Trim(original, " ")
 		byteNum, err := strconv.Atoi(string(stringByteNum))
 		if err != nil {
-			return r, err
+			f.Close()
+			return nil, err
 		}
 		// use the length of the original line (which may
 		// have some number of space characters) + the
 		// line return character to reset the Seeker's
 		// byte position
-		r.Seek(int64(len(original)+1), io.SeekStart)
-		return io.LimitReader(r, int64(byteNum)), nil
+		f.Seek(int64(len(original)+1), io.SeekStart)
+		return readCloser{Reader: io.LimitReader(f, int64(byteNum)), f: f}, nil
 	}
-	return r, errors.New("couldnt find the first line")
+	f.Close()
+	return nil, errors.New("couldnt find the first line")
 }
 
 // Removes the home directory relative path
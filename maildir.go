@@ -0,0 +1,170 @@
+package maildotapp
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ExportOptions controls how ExportMaildir lays out the Maildir
+// hierarchy it writes.
+type ExportOptions struct {
+	// Accounts restricts the export to the named accounts. If empty,
+	// every account is exported.
+	Accounts []string
+	// MaildirPlusPlus follows the Maildir++ convention, where INBOX's
+	// messages live directly under dst/<account> instead of
+	// dst/<account>/INBOX.
+	MaildirPlusPlus bool
+}
+
+const getMessagesForMaildirExport = `
+SELECT
+	m.ROWID as id,
+	mbx.url as url,
+	m.read as read,
+	m.flagged as flagged
+FROM
+	messages m
+LEFT JOIN
+	mailboxes mbx
+ON
+	m.mailbox = mbx.ROWID
+WHERE
+	mbx.url = ?
+`
+
+// ExportMaildir walks every selected account and mailbox, converting
+// each Mail.app message to a clean RFC 5322 message (via stripEmlx)
+// and writing it into a Maildir hierarchy rooted at dst. One Maildir
+// is created per mailbox, at dst/<account>/<mailbox>; see
+// ExportOptions for the Maildir++ INBOX-as-root convention. Nested
+// mailboxes are not nested on disk: path separators in a mailbox
+// name are replaced by "_" (see sanitizeMaildirName).
+func (m Mailboxes) ExportMaildir(dst string, opts ExportOptions) error {
+	wanted := func(account string) bool {
+		if len(opts.Accounts) == 0 {
+			return true
+		}
+		for _, a := range opts.Accounts {
+			if a == account {
+				return true
+			}
+		}
+		return false
+	}
+	for account, mailboxes := range m.byAccountName {
+		if !wanted(account) {
+			continue
+		}
+		for _, mbox := range mailboxes {
+			if err := m.exportMailboxMaildir(dst, account, mbox, opts); err != nil {
+				return fmt.Errorf("exporting %s/%s: %w", account, mbox.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (m Mailboxes) exportMailboxMaildir(dst, account string, mbox Mailbox, opts ExportOptions) error {
+	maildirPath := filepath.Join(dst, sanitizeMaildirName(account), sanitizeMaildirName(mbox.Name))
+	if opts.MaildirPlusPlus && mbox.Name == Inbox {
+		maildirPath = filepath.Join(dst, sanitizeMaildirName(account))
+	}
+	tmpPath := filepath.Join(maildirPath, "tmp")
+	curPath := filepath.Join(maildirPath, "cur")
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(maildirPath, sub), 0755); err != nil {
+			return err
+		}
+	}
+
+	rows, err := m.db.Query(getMessagesForMaildirExport, mbox.URL())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ROWID, u string
+		var read, flagged bool
+		if err := rows.Scan(&ROWID, &u, &read, &flagged); err != nil {
+			return err
+		}
+		MailboxURL, _ := url.Parse(u)
+		relativePath := MailboxURL.Host + MailboxURL.Path
+		basePath, ok := m.url2path[relativePath]
+		if !ok {
+			return fmt.Errorf("unmatched mailbox path: %s", relativePath)
+		}
+		msg := Message{
+			pathWithoutExtension: path.Join(basePath, emlPathFromROWID(ROWID)),
+			rowID:                ROWID,
+		}
+		if err := writeMaildirMessage(tmpPath, curPath, msg, maildirFlags(read, flagged)); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// maildirFlags builds the <flags> part of the ":2,<flags>" suffix
+// (the caller adds the ":2,") from the boolean columns the Envelope Index stores for a message. Flag letters
+// follow the Maildir spec: F(lagged), S(een).
+func maildirFlags(read, flagged bool) string {
+	var flags string
+	if flagged {
+		flags += "F"
+	}
+	if read {
+		flags += "S"
+	}
+	return flags
+}
+
+// writeMaildirMessage writes msg into tmpPath first, fsyncing it
+// before renaming it into curPath, following the Maildir delivery
+// convention so a reader never observes a partially-written file in
+// cur/: a crash or kill partway through only ever leaves a stray
+// file behind in tmp/, never a truncated one in cur/.
+func writeMaildirMessage(tmpPath, curPath string, msg Message, flags string) error {
+	r, err := msg.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	tmpName := filepath.Join(tmpPath, msg.rowID)
+	f, err := os.Create(tmpName)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	finalName := filepath.Join(curPath, fmt.Sprintf("%s:2,%s", msg.rowID, flags))
+	if err := os.Rename(tmpName, finalName); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// sanitizeMaildirName removes path separators from account and
+// mailbox names so they're safe to use as directory components.
+func sanitizeMaildirName(name string) string {
+	return strings.ReplaceAll(name, string(os.PathSeparator), "_")
+}
@@ -0,0 +1,184 @@
+package maildotapp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"howett.net/plist"
+)
+
+// SpecialUse identifies one of the handful of mailbox roles that
+// Mail.app (and IMAP servers generally) treat specially, beyond
+// being an arbitrary user-named folder.
+type SpecialUse int
+
+const (
+	Sent SpecialUse = iota
+	Drafts
+	Trash
+	Junk
+	Archive
+	All
+	Flagged
+)
+
+// specialUseNames lists the mailbox names Mail.app and common IMAP
+// providers use for each SpecialUse, in the order they should be
+// tried. Matching is case-insensitive. This is the last-resort
+// fallback for accounts where neither the Envelope Index nor the
+// account plist tells us anything.
+var specialUseNames = map[SpecialUse][]string{
+	Sent:    {"Sent", "Sent Messages", "[Gmail]/Sent Mail"},
+	Drafts:  {"Drafts", "[Gmail]/Drafts"},
+	Trash:   {"Trash", "Deleted Messages", "Bin", "[Gmail]/Trash", "[Gmail]/Bin"},
+	Junk:    {"Junk", "Spam", "Junk E-mail", "[Gmail]/Spam"},
+	Archive: {"Archive", "All Mail", "[Gmail]/All Mail"},
+	All:     {"All Mail", "[Gmail]/All Mail"},
+	Flagged: {"Flagged", "[Gmail]/Starred"},
+}
+
+func (s SpecialUse) String() string {
+	switch s {
+	case Sent:
+		return "Sent"
+	case Drafts:
+		return "Drafts"
+	case Trash:
+		return "Trash"
+	case Junk:
+		return "Junk"
+	case Archive:
+		return "Archive"
+	case All:
+		return "All"
+	case Flagged:
+		return "Flagged"
+	default:
+		return "Unknown"
+	}
+}
+
+// mailboxTypeHints maps a SpecialUse to the value the Envelope
+// Index's "mailboxes.type" column uses for it. Apple doesn't
+// document this column; these values come from poking at the
+// database, so treat a miss here as "no hint available", not as
+// "this account has no such mailbox".
+var mailboxTypeHints = map[SpecialUse]int{
+	Sent:    3,
+	Drafts:  5,
+	Trash:   2,
+	Junk:    7,
+	Archive: 6,
+}
+
+// accountUUID returns the UUID Mail.app uses to identify account,
+// the same one embedded in its mailboxes' URL()s.
+func (m Mailboxes) accountUUID(account string) (string, bool) {
+	for _, mbox := range m.byAccountName[account] {
+		if mbox.Account != nil {
+			return mbox.Account.UUID, true
+		}
+	}
+	return "", false
+}
+
+// specialUseFromEnvelopeIndex asks the Envelope Index's "type"
+// column whether it already knows which mailbox plays use for
+// account.
+func (m Mailboxes) specialUseFromEnvelopeIndex(account string, use SpecialUse) (Mailbox, bool) {
+	typeHint, ok := mailboxTypeHints[use]
+	if !ok || m.db == nil {
+		return Mailbox{}, false
+	}
+	uuid, ok := m.accountUUID(account)
+	if !ok {
+		return Mailbox{}, false
+	}
+	row := m.db.QueryRow(`SELECT url FROM mailboxes WHERE type = ? AND url LIKE ?`, typeHint, fmt.Sprintf("imap://%s/%%", uuid))
+	var u string
+	if err := row.Scan(&u); err != nil {
+		return Mailbox{}, false
+	}
+	return m.mailboxByURL(u)
+}
+
+// accountsPlistKeys maps a SpecialUse to the key Mail.app stores,
+// per account, in Accounts.plist naming the mailbox URL the user
+// (or an IMAP SPECIAL-USE hint) has designated for that role. There's
+// no public documentation for these keys either; Archive/All/Flagged
+// aren't represented here at all, since Mail.app doesn't track a
+// "preferred" mailbox for them the way it does Sent/Drafts/Trash/Junk.
+var accountsPlistKeys = map[SpecialUse]string{
+	Sent:   "MailPreferredClientSentMessagesMailboxURL",
+	Drafts: "MailPreferredClientDraftsMailboxURL",
+	Trash:  "MailPreferredClientTrashMailboxURL",
+	Junk:   "MailPreferredClientJunkMailboxURL",
+}
+
+// specialUseFromAccountsPlist asks ~/Library/Mail/V10/MailData/Accounts.plist
+// for an IMAP-SPECIAL-USE-style hint: the mailbox URL Mail.app has
+// recorded as account's preferred mailbox for use. Any failure to
+// read or make sense of the plist is treated as "no hint available"
+// rather than an error, since this is a secondary source behind the
+// Envelope Index and ahead of the name-heuristic fallback.
+func (m Mailboxes) specialUseFromAccountsPlist(account string, use SpecialUse) (Mailbox, bool) {
+	key, ok := accountsPlistKeys[use]
+	if !ok {
+		return Mailbox{}, false
+	}
+	uuid, ok := m.accountUUID(account)
+	if !ok {
+		return Mailbox{}, false
+	}
+	f, err := os.Open(filepath.Join(homeDir, "Library/Mail/V10/MailData/Accounts.plist"))
+	if err != nil {
+		return Mailbox{}, false
+	}
+	defer f.Close()
+	var accounts []map[string]interface{}
+	if err := plist.NewDecoder(f).Decode(&accounts); err != nil {
+		return Mailbox{}, false
+	}
+	for _, entry := range accounts {
+		entryUUID, _ := entry["AccountUUID"].(string)
+		if entryUUID != uuid {
+			continue
+		}
+		mailboxURL, ok := entry[key].(string)
+		if !ok {
+			return Mailbox{}, false
+		}
+		return m.mailboxByURL(mailboxURL)
+	}
+	return Mailbox{}, false
+}
+
+// MailboxBySpecialUse resolves the Mailbox playing the given
+// SpecialUse role for account, trying progressively less reliable
+// sources: an Envelope Index type hint, an Accounts.plist
+// IMAP-SPECIAL-USE-style hint, and finally matching against known
+// mailbox names (including Gmail's "[Gmail]/..." names). Only the
+// English names in specialUseNames are matched; localized mailbox
+// names are not recognized.
+func (m Mailboxes) MailboxBySpecialUse(account string, use SpecialUse) (Mailbox, error) {
+	mailboxes, ok := m.byAccountName[account]
+	if !ok {
+		return Mailbox{}, fmt.Errorf("couldn't find account '%s'", account)
+	}
+	if mbox, ok := m.specialUseFromEnvelopeIndex(account, use); ok {
+		return mbox, nil
+	}
+	if mbox, ok := m.specialUseFromAccountsPlist(account, use); ok {
+		return mbox, nil
+	}
+	for _, name := range specialUseNames[use] {
+		for mboxName, mbox := range mailboxes {
+			if strings.EqualFold(mboxName, name) {
+				return mbox, nil
+			}
+		}
+	}
+	return Mailbox{}, fmt.Errorf("couldn't find a %s mailbox for account '%s'", use, account)
+}
@@ -0,0 +1,345 @@
+package maildotapp
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// EventKind identifies what changed about a message in an Event
+// emitted by Mailboxes.Watch.
+type EventKind int
+
+const (
+	Added EventKind = iota
+	Removed
+	FlagsChanged
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case Added:
+		return "Added"
+	case Removed:
+		return "Removed"
+	case FlagsChanged:
+		return "FlagsChanged"
+	default:
+		return "Unknown"
+	}
+}
+
+// Event describes a single change Watch observed in a mailbox.
+type Event struct {
+	Kind    EventKind
+	Message Message
+	Mailbox Mailbox
+}
+
+// seenMessage is everything Watch needs to remember about a message
+// between polls, both to detect a later flag change and to
+// reconstruct an Event for it after it's gone from the mailbox.
+type seenMessage struct {
+	Subject      string
+	Sender       string
+	DateReceived int64
+	Flags        EnvelopeFlags
+}
+
+// Cursor tracks Watch's progress through a set of mailboxes, so
+// callers can snapshot it and resume later without replaying every
+// change since the beginning of time. It's safe for concurrent use:
+// Watch mutates it from its background goroutine while Snapshot can
+// be called from any goroutine to capture a point-in-time,
+// serializable copy.
+type Cursor struct {
+	mu        sync.Mutex
+	positions map[string]map[string]seenMessage // mailbox URL -> ROWID -> seenMessage
+}
+
+// NewCursor returns an empty Cursor. A Watch using it reports every
+// message already in a watched mailbox as Added on its first poll.
+func NewCursor() *Cursor {
+	return &Cursor{positions: map[string]map[string]seenMessage{}}
+}
+
+// CursorSnapshot is the serializable contents of a Cursor, suitable
+// for json.Marshal and for resuming a later Watch via
+// WatchOptions.Cursor.
+type CursorSnapshot map[string]map[string]seenMessage
+
+// Snapshot returns a deep copy of the Cursor's current state.
+func (c *Cursor) Snapshot() CursorSnapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snap := make(CursorSnapshot, len(c.positions))
+	for mboxURL, seen := range c.positions {
+		seenCopy := make(map[string]seenMessage, len(seen))
+		for rowid, sm := range seen {
+			seenCopy[rowid] = sm
+		}
+		snap[mboxURL] = seenCopy
+	}
+	return snap
+}
+
+// NewCursorFromSnapshot resumes a Cursor from a previously-captured
+// CursorSnapshot.
+func NewCursorFromSnapshot(snap CursorSnapshot) *Cursor {
+	c := NewCursor()
+	for mboxURL, seen := range snap {
+		seenCopy := make(map[string]seenMessage, len(seen))
+		for rowid, sm := range seen {
+			seenCopy[rowid] = sm
+		}
+		c.positions[mboxURL] = seenCopy
+	}
+	return c
+}
+
+func (c *Cursor) seenFor(mboxURL string) map[string]seenMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seen := c.positions[mboxURL]
+	seenCopy := make(map[string]seenMessage, len(seen))
+	for rowid, sm := range seen {
+		seenCopy[rowid] = sm
+	}
+	return seenCopy
+}
+
+func (c *Cursor) setSeenFor(mboxURL string, seen map[string]seenMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.positions[mboxURL] = seen
+}
+
+// WatchOptions configures Mailboxes.Watch.
+type WatchOptions struct {
+	// Mailboxes restricts watching to the given mailboxes. If empty,
+	// every known mailbox is watched.
+	Mailboxes []Mailbox
+	// Cursor resumes from a Cursor's earlier position (for instance
+	// one rebuilt with NewCursorFromSnapshot) instead of starting from
+	// an empty one. If nil, Watch uses a fresh Cursor of its own that
+	// the caller has no handle on; pass NewCursor() instead to be able
+	// to Snapshot it.
+	Cursor *Cursor
+	// PollInterval is how often to poll the Envelope Index absent
+	// any fsnotify signal. Defaults to 30s.
+	PollInterval time.Duration
+	// Debounce coalesces bursts of filesystem events (Mail.app's WAL
+	// file is written to repeatedly during a single sync) into a
+	// single poll. Defaults to 2s.
+	Debounce time.Duration
+}
+
+const watchQuery = `
+SELECT
+	m.ROWID as id,
+	mbx.url as url,
+	m.sender as sender,
+	m.subject as subject,
+	m.date_received as date_received,
+	m.read as read,
+	m.flagged as flagged
+FROM
+	messages m
+LEFT JOIN
+	mailboxes mbx
+ON
+	m.mailbox = mbx.ROWID
+WHERE
+	mbx.url = ?
+ORDER BY
+	m.ROWID ASC
+`
+
+// Watch polls the Envelope Index for messages added to, removed
+// from, or reflagged in the watched mailboxes, emitting an Event per
+// change. It combines a polling loop on opts.PollInterval with an
+// fsnotify watch on the Envelope Index's WAL file, which triggers an
+// extra (debounced) poll when something plausibly changed. Watch
+// returns at once; the returned channel is closed once ctx is
+// canceled.
+//
+// There's no way to get sqlite3 change notifications from outside
+// the process that owns the connection, so this is necessarily a
+// polling approach underneath; fsnotify just lets us poll
+// opportunistically instead of on a tight timer. Each poll compares
+// the mailbox's current ROWIDs and flags against opts.Cursor's last
+// snapshot to tell Added from Removed from FlagsChanged.
+func (m Mailboxes) Watch(ctx context.Context, opts WatchOptions) (<-chan Event, error) {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 30 * time.Second
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = 2 * time.Second
+	}
+	mailboxes := opts.Mailboxes
+	if len(mailboxes) == 0 {
+		for _, byName := range m.byAccountName {
+			for _, mbox := range byName {
+				mailboxes = append(mailboxes, mbox)
+			}
+		}
+	}
+	cursor := opts.Cursor
+	if cursor == nil {
+		cursor = NewCursor()
+	}
+
+	// fsnotify is an optimization, not a requirement: if it's
+	// unavailable (sandboxing, an unreadable WAL path, too many open
+	// watches) Watch still works, just falling back to polling purely
+	// on opts.PollInterval instead of waking up opportunistically.
+	var watcher *fsnotify.Watcher
+	var watcherEvents <-chan fsnotify.Event
+	if w, err := fsnotify.NewWatcher(); err != nil {
+		watcherEvents = nil
+	} else {
+		walPath := fmt.Sprintf("%s/Library/Mail/V10/MailData/Envelope Index-wal", homeDir)
+		if err := w.Add(walPath); err != nil {
+			w.Close()
+		} else {
+			watcher = w
+			watcherEvents = w.Events
+		}
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		if watcher != nil {
+			defer watcher.Close()
+		}
+
+		ticker := time.NewTicker(opts.PollInterval)
+		defer ticker.Stop()
+		var debounce *time.Timer
+		poll := make(chan struct{}, 1)
+		requestPoll := func() {
+			select {
+			case poll <- struct{}{}:
+			default:
+			}
+		}
+		requestPoll()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				requestPoll()
+			case _, ok := <-watcherEvents:
+				if !ok {
+					watcherEvents = nil
+					continue
+				}
+				if debounce != nil {
+					debounce.Stop()
+				}
+				debounce = time.AfterFunc(opts.Debounce, requestPoll)
+			case <-poll:
+				for _, mbox := range mailboxes {
+					if !m.pollMailbox(ctx, mbox, cursor, events) {
+						return
+					}
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// pollMailbox diffs mbox's current ROWIDs/flags against cursor's
+// last-seen state, sending one Event per Added, Removed or
+// FlagsChanged message. It returns false if ctx was canceled while
+// trying to send, meaning the caller should stop polling entirely.
+func (m Mailboxes) pollMailbox(ctx context.Context, mbox Mailbox, cursor *Cursor, events chan<- Event) bool {
+	previouslySeen := cursor.seenFor(mbox.URL())
+	currentlySeen := make(map[string]seenMessage, len(previouslySeen))
+
+	rows, err := m.db.Query(watchQuery, mbox.URL())
+	if err != nil {
+		return true
+	}
+	var pending []Event
+	func() {
+		defer rows.Close()
+		for rows.Next() {
+			var ROWID, u, sender, subject string
+			var dateReceived int64
+			var read, flagged bool
+			if err := rows.Scan(&ROWID, &u, &sender, &subject, &dateReceived, &read, &flagged); err != nil {
+				continue
+			}
+			current := seenMessage{
+				Subject:      subject,
+				Sender:       sender,
+				DateReceived: dateReceived,
+				Flags:        EnvelopeFlags{Read: read, Flagged: flagged},
+			}
+			currentlySeen[ROWID] = current
+
+			MailboxURL, _ := url.Parse(u)
+			relativePath := MailboxURL.Host + MailboxURL.Path
+			basePath, ok := m.url2path[relativePath]
+			if !ok {
+				continue
+			}
+			msg := messageFromSeen(basePath, ROWID, current, mbox)
+
+			prior, known := previouslySeen[ROWID]
+			switch {
+			case !known:
+				pending = append(pending, Event{Kind: Added, Message: msg, Mailbox: mbox})
+			case prior.Flags != current.Flags:
+				pending = append(pending, Event{Kind: FlagsChanged, Message: msg, Mailbox: mbox})
+			}
+		}
+	}()
+
+	basePath, haveBasePath := m.url2path[mailboxRelativePath(mbox)]
+	for rowid, prior := range previouslySeen {
+		if _, stillPresent := currentlySeen[rowid]; stillPresent || !haveBasePath {
+			continue
+		}
+		pending = append(pending, Event{Kind: Removed, Message: messageFromSeen(basePath, rowid, prior, mbox), Mailbox: mbox})
+	}
+
+	cursor.setSeenFor(mbox.URL(), currentlySeen)
+
+	for _, ev := range pending {
+		select {
+		case events <- ev:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+func mailboxRelativePath(mbox Mailbox) string {
+	u, _ := url.Parse(mbox.URL())
+	return u.Host + u.Path
+}
+
+func messageFromSeen(basePath, rowid string, sm seenMessage, mbox Mailbox) Message {
+	return Message{
+		pathWithoutExtension: path.Join(basePath, emlPathFromROWID(rowid)),
+		rowID:                rowid,
+		mailbox:              mbox,
+		Envelope: Envelope{
+			Subject: sm.Subject,
+			From:    sm.Sender,
+			Date:    time.Unix(sm.DateReceived, 0),
+			Flags:   sm.Flags,
+		},
+	}
+}
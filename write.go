@@ -0,0 +1,257 @@
+package maildotapp
+
+import (
+	"bytes"
+	"fmt"
+	"net/mail"
+	"os/exec"
+	"strings"
+)
+
+// wrapAppleEventsPermissionError recognizes the specific error
+// osascript returns when macOS hasn't yet granted this process
+// permission to control Mail.app via Apple Events, and turns it into
+// a message that tells the user where to go fix it.
+func wrapAppleEventsPermissionError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if strings.Contains(err.Error(), "not authorized to send Apple events") {
+		return fmt.Errorf("Controlling Mail.app requires Automation permissions.\nYou can grant these permissions in System Preferences > Privacy & Security > Automation.\n\nOriginal error:\n%w", err)
+	}
+	return err
+}
+
+// runAppleScript runs script via osascript, one "-e" argument per
+// non-blank line, the same way getMailboxes already does.
+func runAppleScript(script string) error {
+	var args []string
+	for _, line := range strings.Split(script, "\n") {
+		if len(line) > 0 {
+			args = append(args, "-e", line)
+		}
+	}
+	cmd := exec.Command("osascript", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return wrapAppleEventsPermissionError(fmt.Errorf("osascript: %w: %s", err, strings.TrimSpace(stderr.String())))
+	}
+	return nil
+}
+
+// messageID returns the message's RFC 5322 Message-Id header, which
+// Mail.app's AppleScript dictionary also exposes as a message's
+// "message id" property. Message-Id alone isn't a safe identifier
+// (it's attacker-controlled and can repeat across mailboxes), so
+// callers must also scope the lookup to m.mailbox, the Mailbox this
+// Message's ROWID says it actually lives in.
+func (m Message) messageID() (string, error) {
+	r, err := m.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	parsed, err := mail.ReadMessage(r)
+	if err != nil {
+		return "", err
+	}
+	id := parsed.Header.Get("Message-Id")
+	if id == "" {
+		return "", fmt.Errorf("message has no Message-Id header")
+	}
+	return id, nil
+}
+
+func appleBool(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+// appleScriptString quotes s as an AppleScript string literal. It
+// escapes only the characters AppleScript itself gives meaning to
+// inside a quoted string ('"' and '\') and strips control bytes,
+// rather than relying on some other language's escaping rules
+// (Go's %q, for instance) happening to produce valid AppleScript
+// source for arbitrary attacker-supplied header bytes.
+func appleScriptString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"':
+			b.WriteString(`\"`)
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r < 0x20 || r == 0x7f:
+			// drop control bytes; they have no business in a mailbox
+			// name or Message-Id and AppleScript has no escape for them
+			// inside a quoted string.
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// SetRead marks the message read or unread in Mail.app itself, via
+// AppleScript. This triggers a one-time Automation permission
+// prompt the first time it runs.
+func (m Message) SetRead(read bool) error {
+	return MessageBatch{m}.SetRead(read)
+}
+
+// SetFlagged flags or unflags the message in Mail.app itself, via
+// AppleScript. This triggers a one-time Automation permission
+// prompt the first time it runs.
+func (m Message) SetFlagged(flagged bool) error {
+	return MessageBatch{m}.SetFlagged(flagged)
+}
+
+// MoveTo moves the message into dest in Mail.app itself, via
+// AppleScript. This triggers a one-time Automation permission
+// prompt the first time it runs.
+func (m Message) MoveTo(dest Mailbox) error {
+	return MessageBatch{m}.MoveTo(dest)
+}
+
+// Delete deletes the message in Mail.app itself, via AppleScript.
+// This triggers a one-time Automation permission prompt the first
+// time it runs.
+func (m Message) Delete() error {
+	return MessageBatch{m}.Delete()
+}
+
+// MessageBatch groups messages so that a write operation across all
+// of them runs as a single osascript invocation, instead of
+// spawning one process per message.
+type MessageBatch []Message
+
+// mailboxGroup is every message in a MessageBatch that shares the
+// same source mailbox, identified by its Message-Id.
+type mailboxGroup struct {
+	mailbox Mailbox
+	ids     []string
+}
+
+// groupByMailbox partitions the batch by source mailbox (each
+// Message's ROWID already tells us which one that is), so the
+// generated AppleScript can scope each "whose message id is"
+// lookup to a single mailbox instead of searching the whole store,
+// where a forged or duplicated Message-Id could match an unrelated
+// message.
+func (b MessageBatch) groupByMailbox() ([]mailboxGroup, error) {
+	var order []string
+	groups := map[string]*mailboxGroup{}
+	for i, m := range b {
+		if m.mailbox.IsEmpty() {
+			return nil, fmt.Errorf("message %d of %d: unknown source mailbox, can't safely scope an AppleScript lookup for it", i+1, len(b))
+		}
+		id, err := m.messageID()
+		if err != nil {
+			return nil, fmt.Errorf("message %d of %d: %w", i+1, len(b), err)
+		}
+		key := m.mailbox.URL()
+		g, ok := groups[key]
+		if !ok {
+			g = &mailboxGroup{mailbox: m.mailbox}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.ids = append(g.ids, id)
+	}
+	result := make([]mailboxGroup, len(order))
+	for i, key := range order {
+		result[i] = *groups[key]
+	}
+	return result, nil
+}
+
+// whoseMessageIDInMailbox builds the AppleScript expression that
+// locates every message in g's mailbox whose message id is one of
+// g's ids.
+func whoseMessageIDInMailbox(g mailboxGroup) string {
+	quoted := make([]string, len(g.ids))
+	for i, id := range g.ids {
+		quoted[i] = appleScriptString(id)
+	}
+	return fmt.Sprintf(
+		"(messages of mailbox %s of account %s whose message id is in {%s})",
+		appleScriptString(g.mailbox.Name),
+		appleScriptString(g.mailbox.Account.Name),
+		strings.Join(quoted, ", "),
+	)
+}
+
+// forEachGroup builds one osascript invocation that runs statement
+// (an AppleScript template with a single %s for the "whose" clause)
+// once per mailbox group, so a batch spanning many mailboxes still
+// only spawns a single process.
+func forEachGroup(groups []mailboxGroup, statement string) error {
+	var body strings.Builder
+	body.WriteString("tell application \"Mail\"\n")
+	for _, g := range groups {
+		body.WriteString(fmt.Sprintf(statement, whoseMessageIDInMailbox(g)))
+		body.WriteByte('\n')
+	}
+	body.WriteString("end tell\n")
+	return runAppleScript(body.String())
+}
+
+// SetRead marks every message in the batch read or unread.
+func (b MessageBatch) SetRead(read bool) error {
+	groups, err := b.groupByMailbox()
+	if err != nil {
+		return err
+	}
+	statement := fmt.Sprintf(`
+	repeat with msg in %%s
+		set read status of msg to %s
+	end repeat`, appleBool(read))
+	return forEachGroup(groups, statement)
+}
+
+// SetFlagged flags or unflags every message in the batch.
+func (b MessageBatch) SetFlagged(flagged bool) error {
+	groups, err := b.groupByMailbox()
+	if err != nil {
+		return err
+	}
+	statement := fmt.Sprintf(`
+	repeat with msg in %%s
+		set flagged status of msg to %s
+	end repeat`, appleBool(flagged))
+	return forEachGroup(groups, statement)
+}
+
+// MoveTo moves every message in the batch into dest.
+func (b MessageBatch) MoveTo(dest Mailbox) error {
+	if dest.IsEmpty() {
+		return fmt.Errorf("MoveTo: destination mailbox is empty")
+	}
+	groups, err := b.groupByMailbox()
+	if err != nil {
+		return err
+	}
+	statement := fmt.Sprintf(`
+	repeat with msg in %%s
+		set mailbox of msg to mailbox %s of account %s
+	end repeat`, appleScriptString(dest.Name), appleScriptString(dest.Account.Name))
+	return forEachGroup(groups, statement)
+}
+
+// Delete deletes every message in the batch.
+func (b MessageBatch) Delete() error {
+	groups, err := b.groupByMailbox()
+	if err != nil {
+		return err
+	}
+	statement := `
+	repeat with msg in %s
+		delete msg
+	end repeat`
+	return forEachGroup(groups, statement)
+}